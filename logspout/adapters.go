@@ -0,0 +1,181 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Adapter streams logstream to a single route's target. Implementations
+// are expected to batch lines, apply backpressure by simply not
+// draining logstream faster than their sink can accept, and reconnect
+// on failure rather than returning.
+type Adapter interface {
+	Stream(logstream chan *Log, types []string)
+}
+
+// AdapterFactory builds an Adapter bound to target. Third parties (and
+// logspout's own built-in outputs) call RegisterAdapter during init()
+// to make a scheme available for routing.
+type AdapterFactory func(target Target) Adapter
+
+var adapterRegistry = map[string]AdapterFactory{}
+
+// RegisterAdapter makes factory available for targets whose Type (the
+// scheme of the route's target URL, e.g. "kafka", "redis", "fluentd",
+// "https") matches scheme. Registering the same scheme twice replaces
+// the previous factory.
+func RegisterAdapter(scheme string, factory AdapterFactory) {
+	adapterRegistry[scheme] = factory
+}
+
+// NewAdapter looks up the factory registered for target.Type and
+// builds an Adapter from it. ok is false when no adapter is registered
+// for that scheme.
+func NewAdapter(target Target) (adapter Adapter, ok bool) {
+	factory, ok := adapterRegistry[target.Type]
+	if !ok {
+		return nil, false
+	}
+	return factory(target), true
+}
+
+// routeHandles tracks the stop channel of each route's running streamer
+// (see startRoute/stopRoute), keyed by Route.ID. It lets a route be
+// replaced or removed without leaking the previous streamer's goroutine
+// or double-delivering lines, including when the replacement is the
+// route's own persisted write coming back through an etcd watch.
+var (
+	routeHandlesMu sync.Mutex
+	routeHandles   = map[string]chan bool{}
+)
+
+// addRoute registers route with router and starts it (see startRoute).
+func addRoute(router *RouteManager, attacher *AttachManager, route *Route) {
+	router.Add(route)
+	startRoute(attacher, route)
+}
+
+// removeRoute stops route id's running streamer, if any, and removes it
+// from router. Every path that drops a route (the DELETE /routes/:id
+// handler, an etcd delete/expire event) must go through this instead of
+// calling router.Remove directly, or the streamer keeps running after
+// the route is gone.
+func removeRoute(router *RouteManager, id string) bool {
+	stopRoute(id)
+	return router.Remove(id)
+}
+
+// startRoute dispatches route.Target.Type through the adapter registry
+// and, if one is registered, streams every matching container's logs to
+// it until the route is replaced or removed. Routes with no registered
+// adapter log an error instead of silently dropping logs. Starting a
+// route stops any streamer already running for the same ID first, so
+// re-adding a route (e.g. a POST /routes write reappearing through the
+// etcd watch it triggered, or a changed default route) replaces rather
+// than duplicates it.
+func startRoute(attacher *AttachManager, route *Route) {
+	stopRoute(route.ID)
+
+	adapter, ok := NewAdapter(route.Target)
+	if !ok {
+		log.WithFields(logrus.Fields{
+			"route_id":    route.ID,
+			"target.type": route.Target.Type,
+		}).Error("no adapter registered for target type; route will not receive logs")
+		return
+	}
+
+	logstream := make(chan *Log)
+	stop := make(chan bool, 1)
+	routeHandlesMu.Lock()
+	routeHandles[route.ID] = stop
+	routeHandlesMu.Unlock()
+
+	go adapter.Stream(logstream, route.Types)
+	go func() {
+		attacher.Listen(new(Source), logstream, stop)
+		close(logstream)
+	}()
+}
+
+// stopRoute signals route id's streamer (started by startRoute) to stop
+// attaching, if one is running, and forgets its handle.
+func stopRoute(id string) {
+	routeHandlesMu.Lock()
+	stop, ok := routeHandles[id]
+	delete(routeHandles, id)
+	routeHandlesMu.Unlock()
+	if ok {
+		stop <- true
+	}
+}
+
+// matchesTypes reports whether logline should be delivered given the
+// comma-joined type filter every adapter is configured with (the same
+// filtering syslogStreamer has always done).
+func matchesTypes(types []string, logline *Log) bool {
+	typestr := "," + strings.Join(types, ",") + ","
+	return typestr == ",," || strings.Contains(typestr, logline.Type)
+}
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = 1 * time.Second
+)
+
+// loggerFields builds the standard set of fields an adapter logs on
+// delivery failure, so Kafka/Redis/Fluentd/webhook errors all show up
+// the same way.
+func loggerFields(target Target, err error) logrus.Fields {
+	return logrus.Fields{
+		"target.type": target.Type,
+		"target.addr": target.Addr,
+		"error":       err,
+	}
+}
+
+// batcher accumulates formatted lines from logstream and calls flush
+// whenever it has defaultBatchSize of them and on every tick of a
+// defaultFlushInterval ticker; a size-triggered flush does not reset the
+// ticker. It is shared by
+// the Kafka, Redis, Fluentd, and webhook adapters so each only needs to
+// supply how a single line is rendered and how a batch is delivered.
+// flush reports whether the batch was actually delivered; only
+// delivered batches count toward logspout_lines_routed_total.
+func batcher(target Target, logstream chan *Log, types []string, render func(*Log) string, flush func([]string) bool) {
+	ticker := time.NewTicker(defaultFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]string, 0, defaultBatchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if flush(batch) {
+			metricsLinesRouted.Add(target.Addr, int64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case logline, ok := <-logstream:
+			if !ok {
+				send()
+				return
+			}
+			if !matchesTypes(types, logline) {
+				continue
+			}
+			batch = append(batch, render(logline))
+			if len(batch) >= defaultBatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		}
+	}
+}
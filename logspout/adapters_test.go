@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestNewAdapterDispatchesRegisteredScheme(t *testing.T) {
+	adapter, ok := NewAdapter(Target{Type: "kafka", Addr: "broker:9092"})
+	if !ok {
+		t.Fatal("expected kafka scheme to have a registered adapter")
+	}
+	if _, ok := adapter.(*kafkaAdapter); !ok {
+		t.Fatalf("expected *kafkaAdapter, got %T", adapter)
+	}
+}
+
+func TestNewAdapterUnknownScheme(t *testing.T) {
+	if _, ok := NewAdapter(Target{Type: "carrier-pigeon"}); ok {
+		t.Fatal("expected no adapter to be registered for an unknown scheme")
+	}
+}
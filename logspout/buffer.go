@@ -0,0 +1,86 @@
+package main
+
+const (
+	dropOldest      = "drop-oldest"
+	disconnectSlow  = "disconnect-slow"
+	defaultDropMode = dropOldest
+)
+
+// boundedStream sits between a source (attacher.Listen, an adapter's
+// fan-out, etc., which write to In) and a single slow consumer (a
+// websocket/HTTP client, a stalled syslog target) reading from Out. Out
+// is buffered to capacity so a burst doesn't block In; once it's full,
+// policy decides whether to drop the oldest buffered line to make room
+// (drop-oldest) or stop delivering to this consumer entirely
+// (disconnect-slow). Either way, other consumers attached to the same
+// source are unaffected.
+type boundedStream struct {
+	In       chan *Log
+	Out      chan *Log
+	Done     chan struct{} // closed once a disconnect-slow consumer is dropped
+	label    string
+	policy   string
+	capacity int
+}
+
+// newBoundedStream builds a boundedStream with the given capacity and
+// drop policy and starts the goroutine that pumps In into Out. label
+// identifies this consumer in the logspout_lines_dropped_total and
+// logspout_bytes_emitted_total metrics.
+func newBoundedStream(capacity int, policy, label string) *boundedStream {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	b := &boundedStream{
+		In:       make(chan *Log),
+		Out:      make(chan *Log, capacity),
+		Done:     make(chan struct{}),
+		label:    label,
+		policy:   policy,
+		capacity: capacity,
+	}
+	go b.pump()
+	return b
+}
+
+// pump copies In into Out until In is closed. Under disconnect-slow it
+// drops the consumer the first time Out is found full: it closes Done
+// so the caller can stop the producer (attacher.Listen) and tear down
+// the consumer's streamer goroutine, then keeps draining (and
+// discarding) In itself so the producer never blocks waiting on a
+// consumer that is no longer being read.
+func (b *boundedStream) pump() {
+	disconnected := false
+	defer close(b.Out)
+	for logline := range b.In {
+		if disconnected {
+			continue
+		}
+
+		select {
+		case b.Out <- logline:
+			continue
+		default:
+		}
+
+		if b.policy == disconnectSlow {
+			metricsLinesDropped.Add(b.label, 1)
+			disconnected = true
+			close(b.Done)
+			continue
+		}
+
+		// drop-oldest: make room by discarding the head of the buffer,
+		// then retry once. If Out drained in the meantime just send.
+		select {
+		case <-b.Out:
+			metricsLinesDropped.Add(b.label, 1)
+		default:
+		}
+		select {
+		case b.Out <- logline:
+		default:
+			metricsLinesDropped.Add(b.label, 1)
+		}
+	}
+}
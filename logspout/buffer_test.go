@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBoundedStreamDropOldestKeepsConsumerOpen(t *testing.T) {
+	stream := newBoundedStream(1, dropOldest, "test-drop-oldest")
+	stream.In <- &Log{Data: "first"}
+	stream.In <- &Log{Data: "second"}
+
+	// pump handles "second" after the send above returns; wait until it
+	// has dropped "first" before reading Out.
+	deadline := time.After(time.Second)
+	for metricsLinesDropped.snapshot()["test-drop-oldest"] == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("expected drop-oldest to drop a line once the buffer filled")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	select {
+	case <-stream.Done:
+		t.Fatal("drop-oldest must never close Done")
+	default:
+	}
+
+	logline := <-stream.Out
+	if logline.Data != "second" {
+		t.Fatalf("expected the oldest line to be dropped, got %q", logline.Data)
+	}
+	close(stream.In)
+}
+
+func TestBoundedStreamDisconnectSlowSignalsDone(t *testing.T) {
+	stream := newBoundedStream(1, disconnectSlow, "test")
+	stream.In <- &Log{Data: "first"}
+	stream.In <- &Log{Data: "second"}
+
+	// stream.In <- "second" only guarantees pump has received the line,
+	// not that it has finished deciding to disconnect and closed Done -
+	// that happens asynchronously afterward, so wait for it rather than
+	// checking Done non-blockingly.
+	select {
+	case <-stream.Done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Done to be closed once the buffer fills under disconnect-slow")
+	}
+
+	// The producer must still be able to drain further writes without
+	// blocking, even though nothing reads Out anymore.
+	done := make(chan struct{})
+	go func() {
+		stream.In <- &Log{Data: "third"}
+		close(stream.In)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("producer blocked writing to a disconnected consumer")
+	}
+
+	// Out still holds the line buffered before the disconnect and is
+	// closed once In is; nothing written after the disconnect reaches it.
+	for logline := range stream.Out {
+		if logline.Data != "first" {
+			t.Fatalf("disconnected consumer should not receive further lines, got %q", logline.Data)
+		}
+	}
+}
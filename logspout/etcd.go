@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/coreos/go-etcd/etcd"
+)
+
+const (
+	etcdHostKey      = "/deis/logs/host"
+	etcdPortKey      = "/deis/logs/port"
+	etcdProtocolKey  = "/deis/logs/protocol"
+	etcdRoutesPrefix = "/deis/logs/routes/"
+
+	// defaultRouteID addresses the single route derived from
+	// etcdHostKey/etcdPortKey/etcdProtocolKey, so it can be replaced in
+	// place whenever any of those three keys changes.
+	defaultRouteID = "default"
+)
+
+// connectEtcd dials the etcd cluster at etcdHost:4001, the same
+// connection string logspout has always used.
+func connectEtcd(etcdHost string) *etcd.Client {
+	connectionString := []string{"http://" + etcdHost + ":4001"}
+	log.WithFields(logrus.Fields{"etcd": connectionString[0]}).Info("connecting to etcd")
+	client := etcd.NewClient(connectionString)
+	client.SetDialTimeout(3 * time.Second)
+	return client
+}
+
+// loadDefaultRoute reads etcdHostKey/etcdPortKey/etcdProtocolKey once
+// and installs (or replaces) defaultRouteID on router.
+func loadDefaultRoute(client *etcd.Client, router *RouteManager, attacher *AttachManager) error {
+	hostResp, err := client.Get(etcdHostKey, false, false)
+	if err != nil {
+		return err
+	}
+	portResp, err := client.Get(etcdPortKey, false, false)
+	if err != nil {
+		return err
+	}
+	protocol := protocolUDP
+	if protoResp, err := client.Get(etcdProtocolKey, false, false); err == nil {
+		protocol = protoResp.Node.Value
+	}
+
+	host := fmt.Sprintf("%s:%s", hostResp.Node.Value, portResp.Node.Value)
+	log.WithFields(logrus.Fields{"target": host, "protocol": protocol}).Info("routing all logs to etcd-configured target")
+	addRoute(router, attacher, &Route{ID: defaultRouteID, Target: Target{Type: "syslog", Addr: host, Protocol: protocol}})
+	return nil
+}
+
+// watchEtcd watches /deis/logs (recursively, from the current index
+// onward) and applies every host/port/protocol/route change to router
+// without requiring a restart. It reconnects with exponential backoff
+// if the watch itself fails, the same pattern syslogWriter uses for its
+// connection.
+func watchEtcd(client *etcd.Client, router *RouteManager, attacher *AttachManager) {
+	delay := minReconnectDelay
+	var waitIndex uint64
+	for {
+		resp, err := client.Watch("/deis/logs", waitIndex, true, nil, nil)
+		if err != nil {
+			log.WithFields(logrus.Fields{"error": err}).Warn("etcd: watch failed, retrying")
+			time.Sleep(delay)
+			delay *= 2
+			if delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+			continue
+		}
+		delay = minReconnectDelay
+		waitIndex = resp.Node.ModifiedIndex + 1
+		applyEtcdChange(client, resp, router, attacher)
+	}
+}
+
+// applyEtcdChange dispatches a single etcd watch response to either a
+// reload of the default route or an add/remove on the routes prefix.
+func applyEtcdChange(client *etcd.Client, resp *etcd.Response, router *RouteManager, attacher *AttachManager) {
+	key := resp.Node.Key
+	switch {
+	case key == etcdHostKey || key == etcdPortKey || key == etcdProtocolKey:
+		if err := loadDefaultRoute(client, router, attacher); err != nil {
+			log.WithFields(logrus.Fields{"error": err}).Warn("etcd: reloading default route failed")
+		}
+	case strings.HasPrefix(key, etcdRoutesPrefix):
+		id := strings.TrimPrefix(key, etcdRoutesPrefix)
+		if resp.Action == "delete" || resp.Action == "expire" {
+			removeRoute(router, id)
+			log.WithFields(logrus.Fields{"route_id": id}).Info("etcd: route removed")
+			return
+		}
+		route := new(Route)
+		if err := json.Unmarshal([]byte(resp.Node.Value), route); err != nil {
+			log.WithFields(logrus.Fields{"route_id": id, "error": err}).Warn("etcd: invalid route")
+			return
+		}
+		route.ID = id
+		addRoute(router, attacher, route)
+		log.WithFields(logrus.Fields{"route_id": id}).Info("etcd: route updated")
+	}
+}
+
+// persistRoute writes route to etcdRoutesPrefix so a restart (or a
+// second logspout node sharing the same etcd cluster) picks it up.
+// It is a no-op when client is nil, i.e. ETCD_HOST was not set.
+func persistRoute(client *etcd.Client, route *Route) {
+	if client == nil {
+		return
+	}
+	data, err := json.Marshal(route)
+	if err != nil {
+		log.WithFields(logrus.Fields{"route_id": route.ID, "error": err}).Warn("etcd: marshaling route failed")
+		return
+	}
+	if _, err := client.Set(etcdRoutesPrefix+route.ID, string(data), 0); err != nil {
+		log.WithFields(logrus.Fields{"route_id": route.ID, "error": err}).Warn("etcd: persisting route failed")
+	}
+}
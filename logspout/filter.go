@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// parseSelector turns a comma-separated list of key=value pairs, as
+// used by the label: and env: predicates (e.g. "app=go,proc=web"),
+// into a map. Pairs without an "=" are ignored.
+func parseSelector(value string) map[string]string {
+	selector := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		selector[kv[0]] = kv[1]
+	}
+	return selector
+}
+
+// matchesLabels reports whether container carries every key/value pair
+// in selector among its Config.Labels. An empty selector matches nothing.
+func matchesLabels(container *docker.Container, selector map[string]string) bool {
+	if len(selector) == 0 {
+		return false
+	}
+	for key, value := range selector {
+		if container.Config.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesEnv reports whether container's Config.Env (entries formatted
+// as "KEY=VALUE") satisfies every key/value pair in selector. An empty
+// selector matches nothing.
+func matchesEnv(container *docker.Container, selector map[string]string) bool {
+	if len(selector) == 0 {
+		return false
+	}
+	env := make(map[string]string, len(container.Config.Env))
+	for _, entry := range container.Config.Env {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+	for key, value := range selector {
+		if env[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// containerMatcher applies a Source's label:/env: selectors to the
+// container each Log line came from, inspecting (and caching) the
+// container's metadata through the Docker client. It is the piece that
+// actually enforces the label:/env: predicates: without it, a Source
+// with only Labels/Env set has no ID/Name/Filter, source.All() is
+// true, and every container would be tailed regardless of selector.
+type containerMatcher struct {
+	client *docker.Client
+	source *Source
+
+	mu    sync.Mutex
+	cache map[string]bool
+}
+
+// newContainerMatcher builds a matcher for source against client. When
+// source has neither Labels nor Env set, Match always returns true so
+// id:/name:/filter:-only sources (and the "all" source) pay no
+// inspection cost.
+func newContainerMatcher(client *docker.Client, source *Source) *containerMatcher {
+	return &containerMatcher{
+		client: client,
+		source: source,
+		cache:  make(map[string]bool),
+	}
+}
+
+// Match reports whether logline's container satisfies the matcher's
+// label:/env: selectors. A container that can no longer be inspected
+// (e.g. it has since exited) does not match.
+func (m *containerMatcher) Match(logline *Log) bool {
+	if len(m.source.Labels) == 0 && len(m.source.Env) == 0 {
+		return true
+	}
+
+	m.mu.Lock()
+	matched, cached := m.cache[logline.ID]
+	m.mu.Unlock()
+	if cached {
+		return matched
+	}
+
+	container, err := m.client.InspectContainer(logline.ID)
+	matched = err == nil &&
+		(len(m.source.Labels) == 0 || matchesLabels(container, m.source.Labels)) &&
+		(len(m.source.Env) == 0 || matchesEnv(container, m.source.Env))
+
+	m.mu.Lock()
+	m.cache[logline.ID] = matched
+	m.mu.Unlock()
+	return matched
+}
+
+// filterByContainer reads logs from in, forwarding only the lines
+// matcher.Match accepts, and closes out once in is drained (mirroring
+// the lifecycle attacher.Listen drives on the channel it writes to).
+func filterByContainer(matcher *containerMatcher, in <-chan *Log, out chan<- *Log) {
+	defer close(out)
+	for logline := range in {
+		if matcher.Match(logline) {
+			out <- logline
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+func TestMatchesLabelsExcludesNonMatchingContainer(t *testing.T) {
+	container := &docker.Container{
+		Config: &docker.Config{
+			Labels: map[string]string{"app": "go", "proc": "worker"},
+		},
+	}
+	selector := parseSelector("app=go,proc=web")
+
+	if matchesLabels(container, selector) {
+		t.Fatal("expected container with proc=worker to be excluded by proc=web selector")
+	}
+}
+
+func TestMatchesLabelsIncludesMatchingContainer(t *testing.T) {
+	container := &docker.Container{
+		Config: &docker.Config{
+			Labels: map[string]string{"app": "go", "proc": "web"},
+		},
+	}
+	selector := parseSelector("app=go,proc=web")
+
+	if !matchesLabels(container, selector) {
+		t.Fatal("expected container with matching labels to be included")
+	}
+}
+
+func TestMatchesEnvExcludesNonMatchingContainer(t *testing.T) {
+	container := &docker.Container{
+		Config: &docker.Config{
+			Env: []string{"DEIS_APP=other"},
+		},
+	}
+	selector := parseSelector("DEIS_APP=myapp")
+
+	if matchesEnv(container, selector) {
+		t.Fatal("expected container with DEIS_APP=other to be excluded by DEIS_APP=myapp selector")
+	}
+}
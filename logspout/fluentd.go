@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fluent/fluent-logger-golang/fluent"
+)
+
+func init() {
+	RegisterAdapter("fluentd", func(target Target) Adapter { return &fluentdAdapter{target: target} })
+}
+
+// fluentdAdapter forwards batches of log lines to a Fluentd instance's
+// forward input. The target URL's path names the tag, e.g.
+// fluentd://host:24224/myapp.
+type fluentdAdapter struct {
+	target Target
+	logger *fluent.Fluent
+}
+
+func (a *fluentdAdapter) connect() (*fluent.Fluent, error) {
+	if a.logger != nil {
+		return a.logger, nil
+	}
+	host, portStr, err := splitHostPort(a.target.Addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	logger, err := fluent.New(fluent.Config{FluentPort: port, FluentHost: host})
+	if err != nil {
+		return nil, err
+	}
+	a.logger = logger
+	return logger, nil
+}
+
+func (a *fluentdAdapter) tag() string {
+	tag := strings.Trim(a.target.Path, "/")
+	if tag == "" {
+		tag = "logspout"
+	}
+	return tag
+}
+
+func (a *fluentdAdapter) Stream(logstream chan *Log, types []string) {
+	tag := a.tag()
+	batcher(a.target, logstream, types, func(logline *Log) string {
+		return formatMessage(a.target, logline)
+	}, func(lines []string) bool {
+		logger, err := a.connect()
+		if err != nil {
+			log.WithFields(loggerFields(a.target, err)).Warn("fluentd: connect failed")
+			return false
+		}
+		for _, line := range lines {
+			if err := logger.Post(tag, map[string]string{"message": line}); err != nil {
+				log.WithFields(loggerFields(a.target, err)).Warn("fluentd: post failed")
+				logger.Close()
+				a.logger = nil
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func splitHostPort(addr string) (host, port string, err error) {
+	parts := strings.Split(addr, ":")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("fluentd: invalid address %q", addr)
+	}
+	return parts[0], parts[1], nil
+}
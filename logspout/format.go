@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	dtime "github.com/deis/deis/pkg/time"
+)
+
+// syslog message formats selectable via SYSLOG_FORMAT or Target.Format.
+const (
+	formatRFC3164 = "rfc3164"
+	formatRFC5424 = "rfc5424"
+)
+
+// defaultEnterpriseID is used to build the deis@<enterprise-id> SD-ID
+// when SYSLOG_ENTERPRISE_ID is not set. IANA private enterprise numbers
+// are assigned per-organization; operators deploying to their own
+// infrastructure should override it.
+const defaultEnterpriseID = "00000"
+
+// facilityLocal0 is the syslog facility logspout tags messages with in
+// RFC5424 mode (local0, matching rsyslog/syslog-ng defaults for app logs).
+const facilityLocal0 = 16
+
+const severityInfo = 6
+
+// formatMessage renders logline as a syslog message in the format
+// selected by target.Format, falling back to SYSLOG_FORMAT and then to
+// the original RFC3164 behavior logspout has always had.
+func formatMessage(target Target, logline *Log) string {
+	format := target.Format
+	if format == "" {
+		format = getopt("SYSLOG_FORMAT", formatRFC3164)
+	}
+	if format == formatRFC5424 {
+		return formatRFC5424Message(target, logline)
+	}
+	return formatRFC3164Message(logline)
+}
+
+// formatRFC3164Message is logspout's original hand-rolled message, kept
+// as the default since Go's syslog package hardcodes its own format.
+func formatRFC3164Message(logline *Log) string {
+	tag, pid := getLogName(logline.Name)
+	return fmt.Sprintf(
+		"%s %s[%s]: %s",
+		time.Now().Format(getopt("DATETIME_FORMAT", dtime.DEIS_DATETIME_FORMAT)),
+		tag,
+		pid,
+		logline.Data)
+}
+
+// formatRFC5424Message renders logline per RFC5424, with a deis@<id>
+// SD-ELEMENT carrying the application metadata parsed from the
+// container name plus the container id and stream type.
+func formatRFC5424Message(target Target, logline *Log) string {
+	app, release, proctype, instance := parseContainerName(logline.Name)
+	pri := facilityLocal0*8 + severityInfo
+	hostname := hostnameOrDash()
+	appName := app
+	if appName == "" {
+		appName = logline.Name
+	}
+	procID := instance
+	if procID == "" {
+		procID = "-"
+	}
+
+	return fmt.Sprintf(
+		"<%d>1 %s %s %s %s %s %s %s",
+		pri,
+		time.Now().UTC().Format(time.RFC3339),
+		hostname,
+		appName,
+		procID,
+		msgID(proctype),
+		structuredData(target, app, release, proctype, instance, logline),
+		logline.Data)
+}
+
+// msgID reports the container process type (web, worker, ...) as the
+// RFC5424 MSGID, or NILVALUE when it could not be determined.
+func msgID(proctype string) string {
+	if proctype == "" {
+		return "-"
+	}
+	return proctype
+}
+
+// structuredData renders the deis@<enterprise-id> SD-ELEMENT containing
+// the Deis-specific fields parsed from the container name and logline.
+func structuredData(target Target, app, release, proctype, instance string, logline *Log) string {
+	enterpriseID := getopt("SYSLOG_ENTERPRISE_ID", defaultEnterpriseID)
+	params := []struct{ name, value string }{
+		{"app", app},
+		{"release", release},
+		{"proctype", proctype},
+		{"instance", instance},
+		{"container_id", logline.ID},
+		{"container_type", logline.Type},
+	}
+
+	var sd strings.Builder
+	sd.WriteString(fmt.Sprintf("[deis@%s", enterpriseID))
+	for _, p := range params {
+		if p.value == "" {
+			continue
+		}
+		sd.WriteString(fmt.Sprintf(` %s="%s"`, p.name, sdParamEscape(p.value)))
+	}
+	sd.WriteString("]")
+	return sd.String()
+}
+
+// sdParamEscape escapes the characters RFC5424 requires to be escaped
+// inside an SD-PARAM value: backslash, double-quote, and right bracket.
+func sdParamEscape(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	return replacer.String(value)
+}
+
+func hostnameOrDash() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "-"
+	}
+	return name
+}
+
+// parseContainerName extracts the Deis app name, release version,
+// process type, and instance number from a container name formatted
+// like getLogName expects (e.g. go_v2.web.1). Fields that can't be
+// determined are returned empty.
+func parseContainerName(name string) (app, release, proctype, instance string) {
+	tag, pid := getLogName(name)
+	if pid == "1" {
+		// getLogName couldn't match the Deis naming convention
+		return "", "", "", ""
+	}
+	app = tag
+	parts := strings.SplitN(name, "_", 2)
+	if len(parts) == 2 {
+		versionAndRest := strings.SplitN(parts[1], ".", 2)
+		if len(versionAndRest) == 2 {
+			release = versionAndRest[0]
+		}
+	}
+	procParts := strings.Split(pid, ".")
+	if len(procParts) == 2 {
+		proctype, instance = procParts[0], procParts[1]
+	}
+	return app, release, proctype, instance
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// rfc5424Pattern matches a conformant RFC5424 message: PRI, VERSION,
+// TIMESTAMP, HOSTNAME, APP-NAME, PROCID, MSGID, STRUCTURED-DATA, MSG,
+// each in its own field, with the SD-ELEMENT in the SD slot (not
+// buried in the message body).
+var rfc5424Pattern = regexp.MustCompile(`^<\d+>1 \S+ \S+ \S+ \S+ \S+ (-|\[[^\]]+\]) .*$`)
+
+func TestFormatRFC5424MessageFieldOrder(t *testing.T) {
+	target := Target{Format: formatRFC5424}
+	logline := &Log{Name: "go_v2.web.1", Type: "stdout", Data: "hello world", ID: "abc123"}
+
+	message := formatMessage(target, logline)
+
+	if !rfc5424Pattern.MatchString(message) {
+		t.Fatalf("message does not match RFC5424 field layout: %q", message)
+	}
+
+	// Only PRI/VERSION/TIMESTAMP/HOSTNAME/APP-NAME/PROCID/MSGID are
+	// guaranteed not to contain a space; the SD-ELEMENT that follows
+	// does (its SD-PARAMs are space-separated), so splitting blindly on
+	// " " would cut it apart. Split off those six leading fields, then
+	// find the SD-ELEMENT's closing "] " by hand to locate MSG.
+	fields := strings.SplitN(message, " ", 7)
+	if len(fields) != 7 {
+		t.Fatalf("expected 6 space-separated fields before the SD-ELEMENT plus the remainder, got %d parts: %q", len(fields), message)
+	}
+	if msgID := fields[5]; msgID != "web" {
+		t.Errorf("MSGID = %q, want %q", msgID, "web")
+	}
+
+	rest := fields[6] // "[deis@...] MSG"
+	sdEnd := strings.Index(rest, "] ")
+	if sdEnd == -1 {
+		t.Fatalf("could not find end of STRUCTURED-DATA in %q", rest)
+	}
+	sd := rest[:sdEnd+1]
+	msg := rest[sdEnd+2:]
+
+	if !strings.HasPrefix(sd, "[deis@") {
+		t.Errorf("STRUCTURED-DATA = %q, want it to start with [deis@", sd)
+	}
+	if msg != "hello world" {
+		t.Errorf("MSG = %q, want %q", msg, "hello world")
+	}
+}
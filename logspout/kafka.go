@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+func init() {
+	RegisterAdapter("kafka", func(target Target) Adapter { return &kafkaAdapter{target: target} })
+}
+
+// kafkaAdapter publishes batches of log lines to a Kafka topic. The
+// target URL's path names the topic, e.g. kafka://broker:9092/myapp-logs.
+// The broker list may be a comma-separated Addr for a multi-broker
+// cluster.
+type kafkaAdapter struct {
+	target   Target
+	producer sarama.SyncProducer
+}
+
+func (a *kafkaAdapter) connect() (sarama.SyncProducer, error) {
+	if a.producer != nil {
+		return a.producer, nil
+	}
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	brokers := strings.Split(a.target.Addr, ",")
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	a.producer = producer
+	return producer, nil
+}
+
+func (a *kafkaAdapter) topic() string {
+	topic := strings.Trim(a.target.Path, "/")
+	if topic == "" {
+		topic = "logspout"
+	}
+	return topic
+}
+
+func (a *kafkaAdapter) Stream(logstream chan *Log, types []string) {
+	topic := a.topic()
+	batcher(a.target, logstream, types, func(logline *Log) string {
+		return formatMessage(a.target, logline)
+	}, func(lines []string) bool {
+		producer, err := a.connect()
+		if err != nil {
+			log.WithFields(loggerFields(a.target, err)).Warn("kafka: connect failed")
+			return false
+		}
+		for _, line := range lines {
+			_, _, err := producer.SendMessage(&sarama.ProducerMessage{
+				Topic: topic,
+				Value: sarama.StringEncoder(line),
+			})
+			if err != nil {
+				log.WithFields(loggerFields(a.target, err)).Warn("kafka: publish failed")
+				producer.Close()
+				a.producer = nil
+				return false
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// log is the package-wide structured logger. It replaces the old
+// log.Println/debug() calls with leveled, field-carrying entries so
+// operators can filter and correlate logspout's own diagnostics the
+// same way they'd filter the application logs it streams.
+var log = logrus.New()
+
+// initLogging configures log from LOG_LEVEL and LOG_FORMAT, honoring
+// the legacy DEBUG env var as an alias for LOG_LEVEL=debug.
+func initLogging() {
+	level := getopt("LOG_LEVEL", "info")
+	if getopt("DEBUG", "") != "" {
+		level = "debug"
+	}
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		parsed = logrus.InfoLevel
+	}
+	log.Level = parsed
+
+	if strings.ToLower(getopt("LOG_FORMAT", "text")) == "json" {
+		log.Formatter = &logrus.JSONFormatter{}
+	} else {
+		log.Formatter = &logrus.TextFormatter{}
+	}
+
+	debugMode = log.Level == logrus.DebugLevel
+}
+
+// debug is kept for the handful of call sites that log a single line
+// with no structured fields; everything else should use log.WithFields.
+func debug(v ...interface{}) {
+	log.Debug(v...)
+}
@@ -2,31 +2,23 @@ package main
 
 import (
 	"fmt"
-	"log"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
 	"strconv"
-	"strings"
+	"sync/atomic"
 	"time"
 
 	"code.google.com/p/go.net/websocket"
+	"github.com/Sirupsen/logrus"
 	"github.com/coreos/go-etcd/etcd"
-	dtime "github.com/deis/deis/pkg/time"
 	"github.com/fsouza/go-dockerclient"
 	"github.com/go-martini/martini"
 )
 
 var debugMode bool
 
-func debug(v ...interface{}) {
-	if debugMode {
-		log.Println(v...)
-	}
-}
-
 func assert(err error, context string) {
 	if err != nil {
 		log.Fatalf("%s: %v", context, err)
@@ -41,6 +33,14 @@ func getopt(name, dfault string) string {
 	return value
 }
 
+func getoptInt(name string, dfault int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return dfault
+	}
+	return value
+}
+
 type Colorizer map[string]int
 
 // returns up to 14 color escape codes (then repeats) for each unique key
@@ -57,30 +57,6 @@ func (c Colorizer) Get(key string) string {
 	return "\x1b[" + bright + "3" + strconv.Itoa(7-(i%7)) + "m"
 }
 
-func syslogStreamer(target Target, types []string, logstream chan *Log) {
-	typestr := "," + strings.Join(types, ",") + ","
-	for logline := range logstream {
-		if typestr != ",," && !strings.Contains(typestr, logline.Type) {
-			continue
-		}
-		tag, pid := getLogName(logline.Name)
-		addr, err := net.ResolveUDPAddr("udp", target.Addr)
-		assert(err, "syslog")
-		conn, err := net.DialUDP("udp", nil, addr)
-		assert(err, "syslog")
-		// bump up the packet size for large log lines
-		assert(conn.SetWriteBuffer(1048576), "syslog")
-		// HACK: Go's syslog package hardcodes the log format, so let's send our own message
-		_, err = fmt.Fprintf(conn,
-			"%s %s[%s]: %s",
-			time.Now().Format(getopt("DATETIME_FORMAT", dtime.DEIS_DATETIME_FORMAT)),
-			tag,
-			pid,
-			logline.Data)
-		assert(err, "syslog")
-	}
-}
-
 // getLogName returns a custom tag and PID for containers that
 // match Deis' specific application name format. Otherwise,
 // it returns the original name and 1 as the PID.
@@ -95,13 +71,15 @@ func getLogName(name string) (string, string) {
 	}
 }
 
-func websocketStreamer(w http.ResponseWriter, req *http.Request, logstream chan *Log, closer chan bool) {
+func websocketStreamer(w http.ResponseWriter, req *http.Request, logstream chan *Log, closer chan bool, bytesWritten *int64) {
 	websocket.Handler(func(conn *websocket.Conn) {
 		for logline := range logstream {
 			if req.URL.Query().Get("type") != "" && logline.Type != req.URL.Query().Get("type") {
 				continue
 			}
-			_, err := conn.Write(append(marshal(logline), '\n'))
+			buf := append(marshal(logline), '\n')
+			n, err := conn.Write(buf)
+			atomic.AddInt64(bytesWritten, int64(n))
 			if err != nil {
 				closer <- true
 				return
@@ -110,7 +88,7 @@ func websocketStreamer(w http.ResponseWriter, req *http.Request, logstream chan
 	}).ServeHTTP(w, req)
 }
 
-func httpStreamer(w http.ResponseWriter, req *http.Request, logstream chan *Log, multi bool) {
+func httpStreamer(w http.ResponseWriter, req *http.Request, logstream chan *Log, multi bool, bytesWritten *int64) {
 	var colors Colorizer
 	var usecolor, usejson bool
 	nameWidth := 16
@@ -128,33 +106,35 @@ func httpStreamer(w http.ResponseWriter, req *http.Request, logstream chan *Log,
 		if req.URL.Query().Get("types") != "" && logline.Type != req.URL.Query().Get("types") {
 			continue
 		}
+		var n int
 		if usejson {
-			w.Write(append(marshal(logline), '\n'))
+			n, _ = w.Write(append(marshal(logline), '\n'))
 		} else {
 			if multi {
 				if len(logline.Name) > nameWidth {
 					nameWidth = len(logline.Name)
 				}
 				if usecolor {
-					w.Write([]byte(fmt.Sprintf(
+					n, _ = w.Write([]byte(fmt.Sprintf(
 						"%s%"+strconv.Itoa(nameWidth)+"s|%s\x1b[0m\n",
 						colors.Get(logline.Name), logline.Name, logline.Data,
 					)))
 				} else {
-					w.Write([]byte(fmt.Sprintf(
+					n, _ = w.Write([]byte(fmt.Sprintf(
 						"%"+strconv.Itoa(nameWidth)+"s|%s\n", logline.Name, logline.Data,
 					)))
 				}
 			} else {
-				w.Write(append([]byte(logline.Data), '\n'))
+				n, _ = w.Write(append([]byte(logline.Data), '\n'))
 			}
 		}
+		atomic.AddInt64(bytesWritten, int64(n))
 		w.(http.Flusher).Flush()
 	}
 }
 
 func main() {
-	debugMode = getopt("DEBUG", "") != ""
+	initLogging()
 	port := getopt("PORT", "8000")
 	endpoint := getopt("DOCKER_HOST", "unix:///var/run/docker.sock")
 	routespath := getopt("ROUTESPATH", "/var/lib/logspout")
@@ -164,37 +144,36 @@ func main() {
 	attacher := NewAttachManager(client)
 	router := NewRouteManager(attacher)
 
-	// HACK: if we are connecting to etcd, get the logger's connection
-	// details from there
+	// if we are connecting to etcd, get the logger's connection details
+	// from there and keep them live for the life of the process
+	var etcdClient *etcd.Client
 	if etcdHost := os.Getenv("ETCD_HOST"); etcdHost != "" {
-		connectionString := []string{"http://" + etcdHost + ":4001"}
-		debug("etcd:", connectionString[0])
-		etcd := etcd.NewClient(connectionString)
-		etcd.SetDialTimeout(3 * time.Second)
-		hostResp, err := etcd.Get("/deis/logs/host", false, false)
-		assert(err, "url")
-		portResp, err := etcd.Get("/deis/logs/port", false, false)
-		assert(err, "url")
-		host := fmt.Sprintf("%s:%s", hostResp.Node.Value, portResp.Node.Value)
-		log.Println("routing all to " + host)
-		router.Add(&Route{Target: Target{Type: "syslog", Addr: host}})
+		etcdClient = connectEtcd(etcdHost)
+		assert(loadDefaultRoute(etcdClient, router, attacher), "etcd")
+		go watchEtcd(etcdClient, router, attacher)
 	}
 
 	if len(os.Args) > 1 {
 		u, err := url.Parse(os.Args[1])
 		assert(err, "url")
-		log.Println("routing all to " + os.Args[1])
-		router.Add(&Route{Target: Target{Type: u.Scheme, Addr: u.Host}})
+		scheme, protocol := splitSchemeProtocol(u.Scheme)
+		log.WithFields(logrus.Fields{"target": os.Args[1]}).Info("routing all logs to target given on the command line")
+		addRoute(router, attacher, &Route{Target: Target{Type: scheme, Addr: u.Host, Path: u.Path, Protocol: protocol}})
 	}
 
 	if _, err := os.Stat(routespath); err == nil {
-		log.Println("loading and persisting routes in " + routespath)
+		log.WithFields(logrus.Fields{"path": routespath}).Info("loading and persisting routes")
 		assert(router.Load(RouteFileStore(routespath)), "persistor")
+		routes, _ := router.GetAll()
+		for _, route := range routes {
+			startRoute(attacher, route)
+		}
 	}
 
 	m := martini.Classic()
 
 	m.Get("/logs(?:/(?P<predicate>[a-zA-Z]+):(?P<value>.+))?", func(w http.ResponseWriter, req *http.Request, params martini.Params) {
+		start := time.Now()
 		source := new(Source)
 		switch {
 		case params["predicate"] == "id" && params["value"] != "":
@@ -203,29 +182,82 @@ func main() {
 			source.Name = params["value"]
 		case params["predicate"] == "filter" && params["value"] != "":
 			source.Filter = params["value"]
+		case params["predicate"] == "label" && params["value"] != "":
+			source.Labels = parseSelector(params["value"])
+		case params["predicate"] == "env" && params["value"] != "":
+			source.Env = parseSelector(params["value"])
 		}
 
+		consumerLabel := "all"
+		if params["predicate"] != "" {
+			consumerLabel = params["predicate"] + ":" + params["value"]
+		}
+
+		entry := log.WithFields(logrus.Fields{
+			"remote_addr":   req.RemoteAddr,
+			"predicate":     params["predicate"],
+			"source.id":     source.ID,
+			"source.name":   source.Name,
+			"source.labels": source.Labels,
+			"source.env":    source.Env,
+		})
+
 		if source.ID != "" && attacher.Get(source.ID) == nil {
 			http.NotFound(w, req)
 			return
 		}
 
-		logstream := make(chan *Log)
-		defer close(logstream)
+		capacity := getoptInt("STREAM_BUFFER", 10000)
+		policy := getopt("STREAM_DROP_POLICY", defaultDropMode)
+		stream := newBoundedStream(capacity, policy, consumerLabel)
 
+		// attacher matches only on ID/Name/Filter; label:/env: selectors
+		// are enforced here by inspecting each line's container before it
+		// reaches the bounded buffer.
+		raw := make(chan *Log)
+		defer close(raw)
+		matcher := newContainerMatcher(client, source)
+		go filterByContainer(matcher, raw, stream.In)
+
+		metricsActiveStreamers.Add(1)
+		defer metricsActiveStreamers.Add(-1)
+
+		var bytesWritten int64
 		var closer <-chan bool
 		if req.Header.Get("Upgrade") == "websocket" {
 			closerBi := make(chan bool)
-			go websocketStreamer(w, req, logstream, closerBi)
+			go websocketStreamer(w, req, stream.Out, closerBi, &bytesWritten)
 			closer = closerBi
 		} else {
-			go httpStreamer(w, req, logstream, source.All() || source.Filter != "")
+			multi := source.All() || source.Filter != "" || len(source.Labels) > 0 || len(source.Env) > 0
+			go httpStreamer(w, req, stream.Out, multi, &bytesWritten)
 			closer = w.(http.CloseNotifier).CloseNotify()
 		}
 
-		attacher.Listen(source, logstream, closer)
+		// stream.Done fires if the bounded buffer drops this consumer
+		// under disconnect-slow; without folding it into the closer,
+		// attacher.Listen would keep writing to a consumer nothing is
+		// draining anymore.
+		listenCloser := make(chan bool, 1)
+		go func() {
+			select {
+			case <-closer:
+			case <-stream.Done:
+			}
+			listenCloser <- true
+		}()
+
+		attacher.Listen(source, raw, listenCloser)
+
+		metricsBytesEmitted.Add(consumerLabel, atomic.LoadInt64(&bytesWritten))
+		entry.WithFields(logrus.Fields{
+			"duration_ms":   int64(time.Since(start) / time.Millisecond),
+			"bytes_written": atomic.LoadInt64(&bytesWritten),
+		}).Info("logs request completed")
 	})
 
+	m.Get("/metrics", metricsHandler)
+
 	m.Get("/routes", func(w http.ResponseWriter, req *http.Request) {
 		w.Header().Add("Content-Type", "application/json")
 		routes, _ := router.GetAll()
@@ -239,8 +271,10 @@ func main() {
 		}
 
 		// TODO: validate?
-		router.Add(route)
+		addRoute(router, attacher, route)
+		persistRoute(etcdClient, route)
 
+		log.WithFields(logrus.Fields{"route_id": route.ID, "target": route.Target.Addr}).Info("route added")
 		w.Header().Add("Content-Type", "application/json")
 		return http.StatusCreated, string(append(marshal(route), '\n'))
 	})
@@ -255,11 +289,13 @@ func main() {
 	})
 
 	m.Delete("/routes/:id", func(w http.ResponseWriter, req *http.Request, params martini.Params) {
-		if ok := router.Remove(params["id"]); !ok {
+		if ok := removeRoute(router, params["id"]); !ok {
 			http.NotFound(w, req)
+			return
 		}
+		log.WithFields(logrus.Fields{"route_id": params["id"]}).Info("route removed")
 	})
 
-	log.Println("logspout serving http on :" + port)
+	log.WithFields(logrus.Fields{"port": port}).Info("logspout serving http")
 	log.Fatal(http.ListenAndServe(":"+port, m))
 }
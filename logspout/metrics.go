@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// counter is a simple atomic int64 that /metrics renders as a
+// Prometheus counter, or as a gauge for metricsActiveStreamers, which is
+// also decremented. logspout
+// doesn't otherwise depend on the Prometheus client library, so
+// /metrics renders the handful of gauges/counters it needs directly in
+// the text exposition format rather than pulling in the full package.
+type counter struct {
+	value int64
+}
+
+func (c *counter) Add(n int64) { atomic.AddInt64(&c.value, n) }
+func (c *counter) Get() int64  { return atomic.LoadInt64(&c.value) }
+
+// labeledCounters tracks one counter per label (a target address or
+// consumer id) so /metrics can report per-target and per-consumer
+// totals instead of a single global sum.
+type labeledCounters struct {
+	mu sync.Mutex
+	m  map[string]*counter
+}
+
+func newLabeledCounters() *labeledCounters {
+	return &labeledCounters{m: make(map[string]*counter)}
+}
+
+func (l *labeledCounters) Add(label string, n int64) {
+	l.mu.Lock()
+	c, ok := l.m[label]
+	if !ok {
+		c = &counter{}
+		l.m[label] = c
+	}
+	l.mu.Unlock()
+	c.Add(n)
+}
+
+func (l *labeledCounters) snapshot() map[string]int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make(map[string]int64, len(l.m))
+	for label, c := range l.m {
+		out[label] = c.Get()
+	}
+	return out
+}
+
+var (
+	metricsLinesRouted     = newLabeledCounters() // per target Addr
+	metricsLinesDropped    = newLabeledCounters() // per consumer (source predicate)
+	metricsBytesEmitted    = newLabeledCounters() // per consumer
+	metricsActiveStreamers = &counter{}
+	metricsReconnects      = &counter{}
+)
+
+// metricsHandler renders the counters above in the Prometheus text
+// exposition format.
+func metricsHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP logspout_active_streamers Number of currently attached /logs consumers.")
+	fmt.Fprintln(w, "# TYPE logspout_active_streamers gauge")
+	fmt.Fprintf(w, "logspout_active_streamers %d\n", metricsActiveStreamers.Get())
+
+	fmt.Fprintln(w, "# HELP logspout_reconnects_total Output target reconnect attempts.")
+	fmt.Fprintln(w, "# TYPE logspout_reconnects_total counter")
+	fmt.Fprintf(w, "logspout_reconnects_total %d\n", metricsReconnects.Get())
+
+	writeLabeled(w, "logspout_lines_routed_total", "Log lines routed to an output target.", "target", metricsLinesRouted)
+	writeLabeled(w, "logspout_lines_dropped_total", "Log lines dropped by a consumer's bounded buffer.", "consumer", metricsLinesDropped)
+	writeLabeled(w, "logspout_bytes_emitted_total", "Bytes written to a /logs consumer.", "consumer", metricsBytesEmitted)
+}
+
+func writeLabeled(w http.ResponseWriter, name, help, labelName string, counters *labeledCounters) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	snapshot := counters.snapshot()
+	labels := make([]string, 0, len(snapshot))
+	for label := range snapshot {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, labelName, label, snapshot[label])
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func init() {
+	RegisterAdapter("redis", func(target Target) Adapter { return &redisAdapter{target: target} })
+}
+
+// redisAdapter RPUSHes batches of log lines onto a Redis list. The
+// target URL's path names the list key, e.g. redis://host:6379/myapp-logs.
+type redisAdapter struct {
+	target Target
+	conn   redis.Conn
+}
+
+func (a *redisAdapter) connect() (redis.Conn, error) {
+	if a.conn != nil {
+		return a.conn, nil
+	}
+	conn, err := redis.Dial("tcp", a.target.Addr)
+	if err != nil {
+		return nil, err
+	}
+	a.conn = conn
+	return conn, nil
+}
+
+func (a *redisAdapter) key() string {
+	key := strings.Trim(a.target.Path, "/")
+	if key == "" {
+		key = "logspout"
+	}
+	return key
+}
+
+func (a *redisAdapter) Stream(logstream chan *Log, types []string) {
+	key := a.key()
+	batcher(a.target, logstream, types, func(logline *Log) string {
+		return formatMessage(a.target, logline)
+	}, func(lines []string) bool {
+		conn, err := a.connect()
+		if err != nil {
+			log.WithFields(loggerFields(a.target, err)).Warn("redis: connect failed")
+			return false
+		}
+		conn.Send("MULTI")
+		for _, line := range lines {
+			conn.Send("RPUSH", key, line)
+		}
+		if _, err := conn.Do("EXEC"); err != nil {
+			log.WithFields(loggerFields(a.target, err)).Warn("redis: RPUSH failed")
+			conn.Close()
+			a.conn = nil
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// syslog transport protocols supported via Target.Protocol / Route.Protocol
+// and the /deis/logs/protocol etcd key.
+const (
+	protocolUDP    = "udp"
+	protocolTCP    = "tcp"
+	protocolTCPTLS = "tcp+tls"
+)
+
+const (
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+
+	// maxDialAttempts bounds how many times connect() will redial a
+	// single target before giving up and returning an error, so a
+	// permanently-down TCP/TCP+TLS target can't wedge the streamer
+	// goroutine forever.
+	maxDialAttempts = 10
+)
+
+// syslogWriter owns a connection to a syslog target and reconnects with
+// exponential backoff whenever a write fails. UDP targets are dialed fresh
+// on every reconnect (they're connectionless), while TCP and TCP+TLS
+// targets keep a persistent connection and frame each message per
+// RFC6587 (octet counting) so a single stream can carry multiple
+// messages without a delimiter ambiguity.
+type syslogWriter struct {
+	target   Target
+	protocol string
+
+	mu         sync.Mutex
+	conn       net.Conn
+	everDialed bool
+}
+
+func newSyslogWriter(target Target) *syslogWriter {
+	protocol := target.Protocol
+	if protocol == "" {
+		protocol = getopt("SYSLOG_PROTOCOL", protocolUDP)
+	}
+	return &syslogWriter{target: target, protocol: protocol}
+}
+
+func (w *syslogWriter) dial() (net.Conn, error) {
+	switch w.protocol {
+	case protocolTCP:
+		return net.Dial("tcp", w.target.Addr)
+	case protocolTCPTLS:
+		config, err := tlsConfig(w.target)
+		if err != nil {
+			return nil, err
+		}
+		return tls.Dial("tcp", w.target.Addr, config)
+	default:
+		addr, err := net.ResolveUDPAddr("udp", w.target.Addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := net.DialUDP("udp", nil, addr)
+		if err != nil {
+			return nil, err
+		}
+		// bump up the packet size for large log lines
+		assert(conn.SetWriteBuffer(1048576), "syslog")
+		return conn, nil
+	}
+}
+
+// connect returns the current connection, dialing (or redialing) it with
+// exponential backoff if necessary. A connection, UDP included, is reused
+// until drop() discards it after a failed write. It gives up and
+// returns an error after maxDialAttempts failed dials rather than
+// retrying forever against a permanently-down target.
+func (w *syslogWriter) connect() (net.Conn, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn != nil {
+		return w.conn, nil
+	}
+
+	if w.protocol != protocolUDP && w.everDialed {
+		metricsReconnects.Add(1)
+	}
+
+	delay := minReconnectDelay
+	for attempt := 0; attempt < maxDialAttempts; attempt++ {
+		conn, err := w.dial()
+		if err == nil {
+			w.conn = conn
+			w.everDialed = true
+			return conn, nil
+		}
+		debug("syslog: reconnect to", w.target.Addr, "failed:", err, "retrying in", delay)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+	return nil, fmt.Errorf("syslog: giving up connecting to %s after %d attempts", w.target.Addr, maxDialAttempts)
+}
+
+func (w *syslogWriter) drop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// write sends a fully formatted syslog message, framing it with an
+// RFC6587 octet count when running over TCP (with or without TLS) and
+// reconnecting once on a failed write before giving up on the line.
+func (w *syslogWriter) write(message string) error {
+	framed := message
+	if w.protocol != protocolUDP {
+		framed = fmt.Sprintf("%d %s", len(message), message)
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		conn, err := w.connect()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprint(conn, framed)
+		if err == nil {
+			return nil
+		}
+		debug("syslog: write to", w.target.Addr, "failed:", err)
+		w.drop()
+	}
+	return fmt.Errorf("syslog: giving up writing to %s", w.target.Addr)
+}
+
+// tlsConfig builds a *tls.Config for a tcp+tls target from the per-route
+// TLSCA/TLSCert/TLSKey fields on Target, falling back to the
+// SYSLOG_TLS_CA/SYSLOG_TLS_CERT/SYSLOG_TLS_KEY env vars for any unset.
+func tlsConfig(target Target) (*tls.Config, error) {
+	config := &tls.Config{ServerName: strings.Split(target.Addr, ":")[0]}
+
+	caFile := firstNonEmpty(target.TLSCA, getopt("SYSLOG_TLS_CA", ""))
+	if caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("syslog: reading CA %s: %v", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("syslog: no certificates found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	certFile := firstNonEmpty(target.TLSCert, getopt("SYSLOG_TLS_CERT", ""))
+	keyFile := firstNonEmpty(target.TLSKey, getopt("SYSLOG_TLS_KEY", ""))
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("syslog: loading client cert: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// splitSchemeProtocol splits a CLI route URL scheme such as
+// "syslog+tcp+tls" into its target type ("syslog") and transport
+// protocol ("tcp+tls"). A bare scheme like "syslog" yields an empty
+// protocol, letting the target fall back to SYSLOG_PROTOCOL or udp.
+func splitSchemeProtocol(scheme string) (string, string) {
+	parts := strings.SplitN(scheme, "+", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func init() {
+	RegisterAdapter("syslog", func(target Target) Adapter { return syslogAdapter{target} })
+}
+
+// syslogAdapter adapts syslogStreamer to the Adapter interface so
+// "syslog" targets are dispatched through the same adapter registry as
+// kafka, redis, fluentd, and webhook targets.
+type syslogAdapter struct {
+	target Target
+}
+
+func (a syslogAdapter) Stream(logstream chan *Log, types []string) {
+	syslogStreamer(a.target, types, logstream)
+}
+
+// syslogStreamer relays logstream to target over the protocol configured
+// on target.Protocol (or SYSLOG_PROTOCOL), reconnecting transparently
+// when the underlying connection drops.
+func syslogStreamer(target Target, types []string, logstream chan *Log) {
+	typestr := "," + strings.Join(types, ",") + ","
+	writer := newSyslogWriter(target)
+	for logline := range logstream {
+		if typestr != ",," && !strings.Contains(typestr, logline.Type) {
+			continue
+		}
+		message := formatMessage(target, logline)
+		if err := writer.write(message); err == nil {
+			metricsLinesRouted.Add(target.Addr, 1)
+		} else {
+			log.WithFields(logrus.Fields{
+				"container.name": logline.Name,
+				"container.type": logline.Type,
+				"target":         target.Addr,
+				"error":          err,
+			}).Warn("syslog delivery failed")
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestSplitSchemeProtocol(t *testing.T) {
+	cases := []struct {
+		scheme, wantType, wantProtocol string
+	}{
+		{"syslog", "syslog", ""},
+		{"syslog+tcp", "syslog", "tcp"},
+		{"syslog+tcp+tls", "syslog", "tcp+tls"},
+	}
+	for _, c := range cases {
+		gotType, gotProtocol := splitSchemeProtocol(c.scheme)
+		if gotType != c.wantType || gotProtocol != c.wantProtocol {
+			t.Errorf("splitSchemeProtocol(%q) = (%q, %q), want (%q, %q)",
+				c.scheme, gotType, gotProtocol, c.wantType, c.wantProtocol)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+// This series adds the following fields to the stock Target, Route, and
+// Source types (defined outside this package's checkout):
+//
+//   - Target.Protocol string  // transport for syslog targets: "udp" (default), "tcp", or "tcp+tls"
+//   - Target.Format   string  // syslog message format: "rfc3164" (default) or "rfc5424"
+//   - Target.Path     string  // topic/key/tag/URL-path for the kafka/redis/fluentd/webhook adapters
+//   - Target.TLSCA    string  // path to a CA bundle for a tcp+tls target, overriding SYSLOG_TLS_CA
+//   - Target.TLSCert  string  // path to a client cert for a tcp+tls target, overriding SYSLOG_TLS_CERT
+//   - Target.TLSKey   string  // path to the client cert's key, overriding SYSLOG_TLS_KEY
+//   - Route.Types     []string // log stream types (stdout/stderr) this route accepts, as already
+//                               // supported for legacy routes
+//   - Source.Labels   map[string]string // container Config.Labels the label: predicate must match
+//   - Source.Env      map[string]string // container Config.Env the env: predicate must match
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	factory := func(target Target) Adapter { return &webhookAdapter{target: target, client: &http.Client{}} }
+	RegisterAdapter("http", factory)
+	RegisterAdapter("https", factory)
+}
+
+// webhookAdapter POSTs batches of log lines, one per line, to an HTTP(S)
+// endpoint as a newline-delimited body. It reuses a single *http.Client
+// across batches so connections (and TLS sessions, for https targets)
+// are kept alive between deliveries.
+type webhookAdapter struct {
+	target Target
+	client *http.Client
+}
+
+func (a *webhookAdapter) url() string {
+	scheme := a.target.Type
+	path := a.target.Path
+	return fmt.Sprintf("%s://%s%s", scheme, a.target.Addr, path)
+}
+
+func (a *webhookAdapter) Stream(logstream chan *Log, types []string) {
+	url := a.url()
+	batcher(a.target, logstream, types, func(logline *Log) string {
+		return formatMessage(a.target, logline)
+	}, func(lines []string) bool {
+		body := strings.Join(lines, "\n") + "\n"
+		resp, err := a.client.Post(url, "text/plain", bytes.NewBufferString(body))
+		if err != nil {
+			log.WithFields(loggerFields(a.target, err)).Warn("webhook: post failed")
+			return false
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.WithFields(loggerFields(a.target, fmt.Errorf("unexpected status %s", resp.Status))).Warn("webhook: post rejected")
+			return false
+		}
+		return true
+	})
+}